@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ArrayStatus describes the current state of a single RAID array, as
+// reported by /proc/mdstat.
+type ArrayStatus struct {
+	Name       string   // e.g. "md0"
+	SyncAction string   // "idle", "check", "resync", "recover", or "unknown"
+	Progress   float64  // percent complete, 0 if not syncing
+	ETA        string   // raw finish= value from mdstat, e.g. "123.4min"
+	Speed      string   // raw speed= value from mdstat, e.g. "12345K/sec"
+	DeviceMap  string   // bitmap such as "UU" or "U_", "_" marks a failed/missing member
+	Devices    []string // member devices, e.g. "sda1[0]"
+}
+
+// Checking reports whether this array is currently running a check.
+func (a ArrayStatus) Checking() bool {
+	return a.SyncAction == "check"
+}
+
+// Degraded reports whether the device map for this array shows a missing
+// or failed member.
+func (a ArrayStatus) Degraded() bool {
+	return strings.Contains(a.DeviceMap, "_")
+}
+
+var (
+	arrayHeaderRe = regexp.MustCompile(`^(md\d+)\s*:\s*(\S+)\s+(\S+)\s+(.*)$`)
+	deviceMapRe   = regexp.MustCompile(`\[([U_]+)\]\s*$`)
+	checkBarRe    = regexp.MustCompile(`\[([=>\.]+)\]`)
+	finishRe      = regexp.MustCompile(`finish=(\S+)`)
+	speedRe       = regexp.MustCompile(`speed=(\S+)`)
+)
+
+// discoverArrays lists every RAID array found under /sys/block/md*/md/,
+// sorted by name.
+func discoverArrays() ([]string, error) {
+	matches, err := filepath.Glob("/sys/block/md*/md")
+	if err != nil {
+		return nil, fmt.Errorf("failed to glob for md arrays: %w", err)
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, filepath.Base(filepath.Dir(m)))
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// parseMdstat parses /proc/mdstat into one ArrayStatus per array section.
+func parseMdstat(path string) ([]ArrayStatus, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var arrays []ArrayStatus
+	var current *ArrayStatus
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if m := arrayHeaderRe.FindStringSubmatch(line); m != nil {
+			if current != nil {
+				arrays = append(arrays, *current)
+			}
+			current = &ArrayStatus{
+				Name:       m[1],
+				SyncAction: "idle",
+				Devices:    strings.Fields(m[4]),
+			}
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		if m := deviceMapRe.FindStringSubmatch(line); m != nil {
+			current.DeviceMap = m[1]
+		}
+
+		switch {
+		case strings.Contains(line, "check"):
+			current.SyncAction = "check"
+		case strings.Contains(line, "recover"):
+			current.SyncAction = "recover"
+		case strings.Contains(line, "resync"):
+			current.SyncAction = "resync"
+		default:
+			continue
+		}
+
+		if m := checkBarRe.FindStringSubmatch(line); m != nil {
+			bar := m[1]
+			completed := strings.Count(bar, "=") + strings.Count(bar, ">")
+			current.Progress = float64(completed) / float64(len(bar)) * 100
+		}
+		if m := finishRe.FindStringSubmatch(line); m != nil {
+			current.ETA = m[1]
+		}
+		if m := speedRe.FindStringSubmatch(line); m != nil {
+			current.Speed = m[1]
+		}
+	}
+	if current != nil {
+		arrays = append(arrays, *current)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return arrays, nil
+}
+
+// resolveArrayNames discovers every array under /sys/block/md*/md/, then
+// narrows that list to selected if it is non-empty. It is shared by every
+// command that accepts --array, so they all discover and validate arrays
+// the same way.
+func resolveArrayNames(selected []string) ([]string, error) {
+	names, err := discoverArrays()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(selected) > 0 {
+		names = filterArrayNames(names, selected)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("none of the requested arrays (%s) were found under /sys/block", strings.Join(selected, ", "))
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no RAID arrays found under /sys/block")
+	}
+
+	return names, nil
+}
+
+// getArrayStatuses returns the status of each selected RAID array. If
+// selected is empty, every array discovered under /sys/block/md*/md/ is
+// returned.
+func getArrayStatuses(selected []string) ([]ArrayStatus, error) {
+	names, err := resolveArrayNames(selected)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := parseMdstat(mdstatPath)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]ArrayStatus, len(parsed))
+	for _, a := range parsed {
+		byName[a.Name] = a
+	}
+
+	statuses := make([]ArrayStatus, 0, len(names))
+	for _, name := range names {
+		if a, ok := byName[name]; ok {
+			statuses = append(statuses, a)
+		} else {
+			statuses = append(statuses, ArrayStatus{Name: name, SyncAction: "unknown"})
+		}
+	}
+
+	return statuses, nil
+}
+
+// filterArrayNames returns the subset of names present in selected,
+// preserving the order of names.
+func filterArrayNames(names, selected []string) []string {
+	want := make(map[string]bool, len(selected))
+	for _, s := range selected {
+		want[s] = true
+	}
+
+	var filtered []string
+	for _, n := range names {
+		if want[n] {
+			filtered = append(filtered, n)
+		}
+	}
+
+	return filtered
+}
+
+var (
+	// pPartitionSuffixRe matches the "pN" partition convention used by
+	// devices whose base name already ends in a digit, e.g. nvme0n1p1 or
+	// mmcblk0p1.
+	pPartitionSuffixRe = regexp.MustCompile(`^(.+\d)p\d+$`)
+	// partitionSuffixRe matches the bare-digit partition convention used
+	// by SCSI/SATA-style devices, e.g. sda1.
+	partitionSuffixRe = regexp.MustCompile(`^([a-z]+)\d+$`)
+)
+
+// baseDeviceName maps an mdstat member device token such as "sda1[0]" or
+// "nvme0n1p1[0]" to the underlying whole-disk name ("sda", "nvme0n1"),
+// stripping both the role-number suffix and any partition number. This is
+// how RAID member devices are matched back to their /proc/diskstats
+// entries.
+func baseDeviceName(token string) string {
+	name := deviceRoleRe.ReplaceAllString(token, "")
+	if m := pPartitionSuffixRe.FindStringSubmatch(name); m != nil {
+		return m[1]
+	}
+	if m := partitionSuffixRe.FindStringSubmatch(name); m != nil {
+		return m[1]
+	}
+	return name
+}
+
+// syncActionPath returns the sysfs path used to control the given array's
+// sync_action.
+func syncActionPath(array string) string {
+	return fmt.Sprintf("/sys/block/%s/md/sync_action", array)
+}
+
+// setSyncAction writes to an array's sync_action file.
+func setSyncAction(array, action string) error {
+	return os.WriteFile(syncActionPath(array), []byte(action), 0644)
+}
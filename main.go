@@ -1,12 +1,10 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -15,69 +13,15 @@ import (
 )
 
 const (
-	speedLimitPath = "/proc/sys/dev/raid/speed_limit_max"
-	mdstatPath     = "/proc/mdstat"
-	syncActionPath = "/sys/block/md0/md/sync_action"
+	speedLimitPath    = "/proc/sys/dev/raid/speed_limit_max"
+	speedLimitMinPath = "/proc/sys/dev/raid/speed_limit_min"
+	mdstatPath        = "/proc/mdstat"
 
 	normalSpeed = "200000"
 	highSpeed   = "2000000"
 	lowSpeed    = "3000"
 )
 
-// getMdChecking returns the number of RAID arrays currently being checked
-func getMdChecking() (int, error) {
-	file, err := os.Open(mdstatPath)
-	if err != nil {
-		return 0, fmt.Errorf("failed to open %s: %w", mdstatPath, err)
-	}
-	defer file.Close()
-
-	count := 0
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		if strings.Contains(scanner.Text(), "check") {
-			count++
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return 0, fmt.Errorf("failed to read %s: %w", mdstatPath, err)
-	}
-
-	return count, nil
-}
-
-// getMdProgress extracts the progress percentage from mdstat
-func getMdProgress() (float64, error) {
-	file, err := os.Open(mdstatPath)
-	if err != nil {
-		return 0, fmt.Errorf("failed to open %s: %w", mdstatPath, err)
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, "check") || strings.Contains(line, "resync") {
-			// Look for progress pattern like [====>......]
-			progressRe := regexp.MustCompile(`\[([=>\.]+)\]`)
-			matches := progressRe.FindStringSubmatch(line)
-			if len(matches) > 1 {
-				progress := matches[1]
-				completed := strings.Count(progress, "=") + strings.Count(progress, ">")
-				total := len(progress)
-				return float64(completed) / float64(total) * 100, nil
-			}
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return 0, fmt.Errorf("failed to read %s: %w", mdstatPath, err)
-	}
-
-	return 0, fmt.Errorf("no progress information found")
-}
-
 // drawProgressBar creates a progress bar string with the given percentage
 func drawProgressBar(percent float64, width int) string {
 	completed := int(float64(width) * percent / 100)
@@ -93,34 +37,6 @@ func drawProgressBar(percent float64, width int) string {
 	return fmt.Sprintf("[%s] %.1f%%", bar, percent)
 }
 
-// getMdTimeLeft extracts the time left from mdstat
-func getMdTimeLeft() (string, error) {
-	file, err := os.Open(mdstatPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to open %s: %w", mdstatPath, err)
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, "finish") {
-			// Use regex to extract finish=XXXmin
-			re := regexp.MustCompile(`finish=([^\\s]+)`)
-			matches := re.FindStringSubmatch(line)
-			if len(matches) > 1 {
-				return matches[1], nil
-			}
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("failed to read %s: %w", mdstatPath, err)
-	}
-
-	return "", nil
-}
-
 // getCurrentSpeed reads the current RAID speed limit
 func getCurrentSpeed() (string, error) {
 	data, err := os.ReadFile(speedLimitPath)
@@ -135,20 +51,64 @@ func setSpeed(speed string) error {
 	return os.WriteFile(speedLimitPath, []byte(speed), 0644)
 }
 
-// setSyncAction writes to the sync_action file
-func setSyncAction(action string) error {
-	return os.WriteFile(syncActionPath, []byte(action), 0644)
+// getMinSpeed reads the current RAID minimum speed limit
+func getMinSpeed() (string, error) {
+	data, err := os.ReadFile(speedLimitMinPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read min speed limit: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// speedForName maps a named speed mode ("normal", "high", or "low") to the
+// corresponding /proc/sys/dev/raid/speed_limit_max value. It is the single
+// source of truth for that mapping, shared by the scheduler and the
+// metrics exporter.
+func speedForName(name string) (string, error) {
+	switch name {
+	case "normal":
+		return normalSpeed, nil
+	case "high":
+		return highSpeed, nil
+	case "low":
+		return lowSpeed, nil
+	default:
+		return "", fmt.Errorf("unknown speed %q (want normal, high, or low)", name)
+	}
 }
 
 func main() {
+	var selectedArrays []string
+	var notifyConfigPath string
+	var outputFormat string
+	var watch bool
+	var watchInterval time.Duration
+
 	var rootCmd = &cobra.Command{
 		Use:   "raid-helper",
 		Short: "A tool for managing Linux software RAID operations",
 		Long:  "raid-helper provides commands to control RAID check speeds, start/stop operations, and manage reboots.",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			_, err := parseOutputFormat(outputFormat)
+			return err
+		},
 		Run: func(cmd *cobra.Command, args []string) {
-			showStatus()
+			render := func() error {
+				return renderStatus(selectedArrays, outputFormat, func(selected []string) error {
+					showStatus(selected)
+					return nil
+				})
+			}
+			if err := runStatusLoop(watch, watchInterval, render); err != nil {
+				log.Fatalf("Error checking RAID status: %v", err)
+			}
 		},
 	}
+	rootCmd.PersistentFlags().StringArrayVar(&selectedArrays, "array", nil, "limit the command to this array (e.g. md1); repeatable, defaults to all arrays")
+	rootCmd.PersistentFlags().StringVar(&notifyConfigPath, "notify-config", "", "path to a notify sink config file; if set, reboot/forcereboot send reboot events through it")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output", "text", "output format for status commands: text or json")
+	rootCmd.PersistentFlags().BoolVar(&watch, "watch", false, "keep running, streaming one status update per --watch-interval (NDJSON when --output=json)")
+	rootCmd.PersistentFlags().DurationVar(&watchInterval, "watch-interval", 2*time.Second, "how often to emit a status update when --watch is set")
 
 	var normalCmd = &cobra.Command{
 		Use:   "normal",
@@ -200,9 +160,15 @@ func main() {
 		Use:   "stop",
 		Short: "Stop RAID check",
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("Stopping raid check")
-			if err := setSyncAction("idle"); err != nil {
-				log.Fatalf("Error stopping raid check: %v", err)
+			arrays, err := resolveArrayNames(selectedArrays)
+			if err != nil {
+				log.Fatalf("Error discovering arrays: %v", err)
+			}
+			for _, name := range arrays {
+				fmt.Printf("Stopping raid check on %s\n", name)
+				if err := setSyncAction(name, "idle"); err != nil {
+					log.Fatalf("Error stopping raid check on %s: %v", name, err)
+				}
 			}
 		},
 	}
@@ -211,9 +177,15 @@ func main() {
 		Use:   "start",
 		Short: "Start RAID check",
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("Starting raid check")
-			if err := setSyncAction("check"); err != nil {
-				log.Fatalf("Error starting raid check: %v", err)
+			arrays, err := resolveArrayNames(selectedArrays)
+			if err != nil {
+				log.Fatalf("Error discovering arrays: %v", err)
+			}
+			for _, name := range arrays {
+				fmt.Printf("Starting raid check on %s\n", name)
+				if err := setSyncAction(name, "check"); err != nil {
+					log.Fatalf("Error starting raid check on %s: %v", name, err)
+				}
 			}
 		},
 	}
@@ -222,11 +194,10 @@ func main() {
 		Use:   "check",
 		Short: "Check if RAID is currently being checked",
 		Run: func(cmd *cobra.Command, args []string) {
-			count, err := getMdChecking()
-			if err != nil {
+			render := func() error { return renderStatus(selectedArrays, outputFormat, printCheckCount) }
+			if err := runStatusLoop(watch, watchInterval, render); err != nil {
 				log.Fatalf("Error checking RAID status: %v", err)
 			}
-			fmt.Println(count)
 		},
 	}
 
@@ -234,30 +205,10 @@ func main() {
 		Use:   "progress",
 		Short: "Show RAID check progress with a progress bar",
 		Run: func(cmd *cobra.Command, args []string) {
-			count, err := getMdChecking()
-			if err != nil {
+			render := func() error { return renderStatus(selectedArrays, outputFormat, printProgress) }
+			if err := runStatusLoop(watch, watchInterval, render); err != nil {
 				log.Fatalf("Error checking RAID status: %v", err)
 			}
-
-			if count == 0 {
-				fmt.Println("No RAID check in progress")
-				return
-			}
-
-			progress, err := getMdProgress()
-			if err != nil {
-				log.Fatalf("Error getting progress: %v", err)
-			}
-
-			timeLeft, err := getMdTimeLeft()
-			if err != nil {
-				log.Printf("Error getting time left: %v", err)
-			}
-
-			fmt.Println(drawProgressBar(progress, 50))
-			if timeLeft != "" {
-				fmt.Printf("Time remaining: %s\n", timeLeft)
-			}
 		},
 	}
 
@@ -265,7 +216,8 @@ func main() {
 		Use:   "reboot",
 		Short: "Reboot the machine once the RAID check is done",
 		Run: func(cmd *cobra.Command, args []string) {
-			waitForRaidAndReboot(false)
+			notifyIfConfigured(notifyConfigPath, Event{Type: EventRebootPending, At: time.Now()})
+			waitForRaidAndReboot(selectedArrays, false, notifyConfigPath)
 		},
 	}
 
@@ -273,22 +225,84 @@ func main() {
 		Use:   "forcereboot",
 		Short: "Stop RAID check and reboot",
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := setSyncAction("idle"); err != nil {
-				log.Fatalf("Error stopping raid check: %v", err)
+			notifyIfConfigured(notifyConfigPath, Event{Type: EventRebootPending, At: time.Now()})
+			arrays, err := resolveArrayNames(selectedArrays)
+			if err != nil {
+				log.Fatalf("Error discovering arrays: %v", err)
+			}
+			for _, name := range arrays {
+				if err := setSyncAction(name, "idle"); err != nil {
+					log.Fatalf("Error stopping raid check on %s: %v", name, err)
+				}
 			}
-			waitForRaidAndReboot(true)
+			waitForRaidAndReboot(selectedArrays, true, notifyConfigPath)
 		},
 	}
-	
+
 	var showStatusOnlyCmd = &cobra.Command{
 		Use:   "showstatus",
 		Short: "Shows the status without the list of commands",
 		Run: func(cmd *cobra.Command, args []string) {
-			showOnlyStatus()
+			render := func() error {
+				return renderStatus(selectedArrays, outputFormat, func(selected []string) error {
+					showOnlyStatus(selected)
+					return nil
+				})
+			}
+			if err := runStatusLoop(watch, watchInterval, render); err != nil {
+				log.Fatalf("Error checking RAID status: %v", err)
+			}
 		},
 	}
 
-	rootCmd.AddCommand(normalCmd, highCmd, lowCmd, stopCmd, startCmd, checkCmd, progressCmd, rebootCmd, forceRebootCmd, showStatusOnlyCmd)
+	var listen string
+	var cacheTTL time.Duration
+	var serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve Prometheus metrics over HTTP",
+		Long:  "Run an HTTP server exposing RAID check state as Prometheus metrics at /metrics.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := serveMetrics(listen, cacheTTL, selectedArrays); err != nil {
+				log.Fatalf("Error serving metrics: %v", err)
+			}
+		},
+	}
+	serveCmd.Flags().StringVar(&listen, "listen", ":9100", "address to listen on")
+	serveCmd.Flags().DurationVar(&cacheTTL, "cache-ttl", 5*time.Second, "how long to cache /proc/mdstat reads between scrapes")
+
+	var scheduleConfigPath string
+	var schedulePauseStateDir string
+	var scheduleCmd = &cobra.Command{
+		Use:   "schedule",
+		Short: "Run the adaptive speed/pause scheduler",
+		Long:  "Run a long-lived controller that sets RAID check speed from time-of-day and load policies in a config file, pausing checks entirely under sustained I/O load.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runScheduler(scheduleConfigPath, selectedArrays, schedulePauseStateDir); err != nil {
+				log.Fatalf("Error running scheduler: %v", err)
+			}
+		},
+	}
+	scheduleCmd.Flags().StringVar(&scheduleConfigPath, "config", "/etc/raid-helper/schedule.yaml", "path to the schedule policy file")
+	scheduleCmd.Flags().StringVar(&schedulePauseStateDir, "pause-state-dir", defaultPauseStateDir, "directory to record arrays idled by the pause guard, read by `notify` to distinguish a pause from a finished check")
+
+	var notifyWatchConfigPath string
+	var notifyInterval time.Duration
+	var notifyPauseStateDir string
+	var notifyCmd = &cobra.Command{
+		Use:   "notify",
+		Short: "Watch arrays and fire notifications on check/device events",
+		Long:  "Run a long-lived watcher that emits events through the configured sinks (SMTP, webhook, Slack, Discord) when a check starts, completes, stalls, or a device looks degraded.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runNotifyWatch(notifyWatchConfigPath, selectedArrays, notifyInterval, notifyPauseStateDir); err != nil {
+				log.Fatalf("Error running notify watcher: %v", err)
+			}
+		},
+	}
+	notifyCmd.Flags().StringVar(&notifyWatchConfigPath, "config", "/etc/raid-helper/notify.yaml", "path to the notify sink config file")
+	notifyCmd.Flags().DurationVar(&notifyInterval, "interval", 30*time.Second, "how often to poll array status for events")
+	notifyCmd.Flags().StringVar(&notifyPauseStateDir, "pause-state-dir", defaultPauseStateDir, "directory the `schedule` command records pause-guard state in, so a pause isn't reported as a completed check")
+
+	rootCmd.AddCommand(normalCmd, highCmd, lowCmd, stopCmd, startCmd, checkCmd, progressCmd, rebootCmd, forceRebootCmd, showStatusOnlyCmd, serveCmd, scheduleCmd, notifyCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -296,50 +310,105 @@ func main() {
 	}
 }
 
+// printCheckCount prints the number of arrays currently being checked, the
+// text-mode rendering used by the `check` command.
+func printCheckCount(selected []string) error {
+	arrays, err := getArrayStatuses(selected)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, a := range arrays {
+		if a.Checking() {
+			count++
+		}
+	}
+	fmt.Println(count)
+
+	return nil
+}
+
+// printProgress prints a progress bar per checking array, the text-mode
+// rendering used by the `progress` command.
+func printProgress(selected []string) error {
+	arrays, err := getArrayStatuses(selected)
+	if err != nil {
+		return err
+	}
+
+	any := false
+	for _, a := range arrays {
+		if !a.Checking() {
+			continue
+		}
+		any = true
+		fmt.Printf("%s: %s\n", a.Name, drawProgressBar(a.Progress, 50))
+		if a.ETA != "" {
+			fmt.Printf("Time remaining: %s\n", a.ETA)
+		}
+	}
+	if !any {
+		fmt.Println("No RAID check in progress")
+	}
+
+	return nil
+}
 
-func showOnlyStatus() { 
+func showOnlyStatus(selected []string) {
 	fmt.Println("###############################")
 	currentTime := time.Now()
 	fmt.Println("#", currentTime.Format("2006-01-02 15:04:03"), "        #")
-	isChecking, err := getMdChecking()
+
+	arrays, err := getArrayStatuses(selected)
 	if err != nil {
 		log.Printf("Error checking RAID status: %v", err)
-	} else if isChecking > 0 {
-		fmt.Println("# Currently Checking RAID         #")
-		if timeLeft, err := getMdTimeLeft(); err == nil && timeLeft != "" {
-			fmt.Printf("# Time left %-18s #\n", timeLeft)
+	} else {
+		for _, a := range arrays {
+			if !a.Checking() {
+				continue
+			}
+			fmt.Printf("# %-6s Currently Checking RAID #\n", a.Name)
+			if a.ETA != "" {
+				fmt.Printf("# Time left %-18s #\n", a.ETA)
+			}
 		}
 	}
+
 	speed, err := getCurrentSpeed()
 	if err != nil {
-	        log.Printf("Error reading current speed: %v", err)
+		log.Printf("Error reading current speed: %v", err)
 	} else {
-	        switch speed {
-	        case normalSpeed:
-	             fmt.Println("# Speed Normal                 #")
-                case highSpeed:
-                     fmt.Println("# Speed High                   #")
-                case lowSpeed:
-                     fmt.Println("# Speed Low                    #")
-                }
-	}
-        fmt.Println("################################")
+		switch speed {
+		case normalSpeed:
+			fmt.Println("# Speed Normal                 #")
+		case highSpeed:
+			fmt.Println("# Speed High                   #")
+		case lowSpeed:
+			fmt.Println("# Speed Low                    #")
+		}
+	}
+	fmt.Println("################################")
 }
 
-func showStatus() {
+func showStatus(selected []string) {
 	fmt.Println("################################")
 	currentTime := time.Now()
 	fmt.Println("#", currentTime.Format("2006-01-02 15:04:03"), "         #")
-	isChecking, err := getMdChecking()
+
+	arrays, err := getArrayStatuses(selected)
 	if err != nil {
 		log.Printf("Error checking RAID status: %v", err)
-	} else if isChecking > 0 {
-		fmt.Println("# Currently Checking Raid      #")
-		if timeLeft, err := getMdTimeLeft(); err == nil && timeLeft != "" {
-			fmt.Printf("# Time left %-18s #\n", timeLeft)
-		}
-		if progress, err := getMdProgress(); err == nil {
-			progressBar := drawProgressBar(progress, 20)
+	} else {
+		for _, a := range arrays {
+			if !a.Checking() {
+				continue
+			}
+			fmt.Printf("# %-6s Currently Checking Raid #\n", a.Name)
+			if a.ETA != "" {
+				fmt.Printf("# Time left %-18s #\n", a.ETA)
+			}
+			progressBar := drawProgressBar(a.Progress, 20)
 			fmt.Printf("# %-24s #\n", progressBar)
 		}
 	}
@@ -369,18 +438,27 @@ func showStatus() {
 	fmt.Println("forcereboot - Stop raid check and reboot")
 	fmt.Println("stop        - Stop raid check")
 	fmt.Println("start       - Start raid check")
+	fmt.Println("Use --array md1 (repeatable) to limit any command to specific arrays")
+	fmt.Println("Use --output json for machine-readable status, --watch to stream it")
 }
 
-func waitForRaidAndReboot(forced bool) {
+func waitForRaidAndReboot(selected []string, forced bool, notifyConfigPath string) {
 	for {
-		count, err := getMdChecking()
+		arrays, err := getArrayStatuses(selected)
 		if err != nil {
 			log.Printf("Error checking RAID status: %v", err)
 			time.Sleep(10 * time.Second)
 			continue
 		}
 
-		if count == 0 {
+		checking := false
+		for _, a := range arrays {
+			if a.Checking() {
+				checking = true
+				break
+			}
+		}
+		if !checking {
 			break
 		}
 
@@ -389,34 +467,36 @@ func waitForRaidAndReboot(forced bool) {
 		// Clear screen (simple version)
 		fmt.Print("\033[2J\033[H")
 
-		timeLeft, err := getMdTimeLeft()
-		if err != nil {
-			log.Printf("Error getting time left: %v", err)
-		}
-
 		fmt.Println(time.Now().Format("Mon Jan 2 15:04:05 MST 2006"))
-		if timeLeft != "" {
-			fmt.Printf("Reboot will occur in %s\n", timeLeft)
-		} else {
-			fmt.Println("Reboot will occur when RAID check completes")
-		}
-
-		if progress, err := getMdProgress(); err == nil {
-			fmt.Println(drawProgressBar(progress, 50))
+		for _, a := range arrays {
+			if !a.Checking() {
+				continue
+			}
+			if a.ETA != "" {
+				fmt.Printf("%s: reboot will occur in %s\n", a.Name, a.ETA)
+			} else {
+				fmt.Printf("%s: reboot will occur when RAID check completes\n", a.Name)
+			}
+			fmt.Println(drawProgressBar(a.Progress, 50))
 		}
 	}
 
 	// Final check
-	count, err := getMdChecking()
+	arrays, err := getArrayStatuses(selected)
 	if err != nil {
 		log.Fatalf("Error in final RAID check: %v", err)
 	}
 
-	if count == 0 {
-		fmt.Println("RAID check complete. Rebooting...")
-		cmd := exec.Command("reboot")
-		if err := cmd.Run(); err != nil {
-			log.Fatalf("Error executing reboot: %v", err)
+	for _, a := range arrays {
+		if a.Checking() {
+			return
 		}
 	}
+
+	fmt.Println("RAID check complete. Rebooting...")
+	notifyIfConfigured(notifyConfigPath, Event{Type: EventRebooting, At: time.Now()})
+	cmd := exec.Command("reboot")
+	if err := cmd.Run(); err != nil {
+		log.Fatalf("Error executing reboot: %v", err)
+	}
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsSnapshot holds the values published by the /metrics endpoint.
+type metricsSnapshot struct {
+	arrays     []ArrayStatus
+	speedLimit string
+}
+
+// metricsCollector refreshes a metricsSnapshot from /proc/mdstat and the
+// speed limit file, caching the result for cacheTTL so that repeated
+// scrapes don't hammer the proc filesystem.
+type metricsCollector struct {
+	selected []string
+	cacheTTL time.Duration
+
+	mu       sync.Mutex
+	snapshot metricsSnapshot
+	fetched  time.Time
+}
+
+func newMetricsCollector(selected []string, cacheTTL time.Duration) *metricsCollector {
+	return &metricsCollector{selected: selected, cacheTTL: cacheTTL}
+}
+
+// snapshotNow returns the cached metricsSnapshot, refreshing it first if the
+// cache has expired.
+func (c *metricsCollector) snapshotNow() metricsSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.fetched) < c.cacheTTL {
+		return c.snapshot
+	}
+
+	arrays, err := getArrayStatuses(c.selected)
+	if err != nil {
+		log.Printf("metrics: error getting array statuses: %v", err)
+	}
+
+	speed, err := getCurrentSpeed()
+	if err != nil {
+		log.Printf("metrics: error reading current speed: %v", err)
+	}
+
+	c.snapshot = metricsSnapshot{
+		arrays:     arrays,
+		speedLimit: speed,
+	}
+	c.fetched = time.Now()
+
+	return c.snapshot
+}
+
+// parseEtaSeconds converts an mdstat finish= value such as "123.4min" into
+// a number of seconds.
+func parseEtaSeconds(finish string) (float64, error) {
+	value := strings.TrimSuffix(finish, "min")
+	minutes, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse eta %q: %w", finish, err)
+	}
+	return minutes * 60, nil
+}
+
+// ServeHTTP renders the current snapshot in Prometheus text exposition format.
+func (c *metricsCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snap := c.snapshotNow()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP raidhelper_check_in_progress Whether a RAID check is currently running (1) or not (0).")
+	fmt.Fprintln(w, "# TYPE raidhelper_check_in_progress gauge")
+	for _, a := range snap.arrays {
+		fmt.Fprintf(w, "raidhelper_check_in_progress{array=%q} %d\n", a.Name, boolToInt(a.Checking()))
+	}
+
+	fmt.Fprintln(w, "# HELP raidhelper_check_progress_percent Percentage complete of the current RAID check.")
+	fmt.Fprintln(w, "# TYPE raidhelper_check_progress_percent gauge")
+	for _, a := range snap.arrays {
+		fmt.Fprintf(w, "raidhelper_check_progress_percent{array=%q} %f\n", a.Name, a.Progress)
+	}
+
+	fmt.Fprintln(w, "# HELP raidhelper_check_eta_seconds Estimated time remaining for the current RAID check, in seconds.")
+	fmt.Fprintln(w, "# TYPE raidhelper_check_eta_seconds gauge")
+	for _, a := range snap.arrays {
+		if a.ETA == "" {
+			continue
+		}
+		seconds, err := parseEtaSeconds(a.ETA)
+		if err != nil {
+			log.Printf("metrics: error parsing eta %q for %s: %v", a.ETA, a.Name, err)
+			continue
+		}
+		fmt.Fprintf(w, "raidhelper_check_eta_seconds{array=%q} %f\n", a.Name, seconds)
+	}
+
+	fmt.Fprintln(w, "# HELP raidhelper_speed_limit_max_kbps Current value of /proc/sys/dev/raid/speed_limit_max, in KB/s.")
+	fmt.Fprintln(w, "# TYPE raidhelper_speed_limit_max_kbps gauge")
+	fmt.Fprintf(w, "raidhelper_speed_limit_max_kbps %s\n", orZero(snap.speedLimit))
+
+	fmt.Fprintln(w, "# HELP raidhelper_speed_mode Which named speed mode the current speed limit matches.")
+	fmt.Fprintln(w, "# TYPE raidhelper_speed_mode gauge")
+	for _, mode := range []string{"normal", "high", "low"} {
+		speed, _ := speedForName(mode)
+		fmt.Fprintf(w, "raidhelper_speed_mode{mode=%q} %d\n", mode, boolToInt(snap.speedLimit == speed))
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func orZero(s string) string {
+	if s == "" {
+		return "0"
+	}
+	return s
+}
+
+// serveMetrics starts an HTTP server exposing Prometheus metrics for
+// selected (or every array, if empty) at /metrics until the process is
+// killed.
+func serveMetrics(listen string, cacheTTL time.Duration, selected []string) error {
+	collector := newMetricsCollector(selected, cacheTTL)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", collector)
+
+	log.Printf("Listening on %s, serving /metrics with a %s cache TTL", listen, cacheTTL)
+	return http.ListenAndServe(listen, mux)
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sinkTimeout bounds how long any single sink delivery may take. Sink
+// delivery runs synchronously in front of reboot/forcereboot, so an
+// unreachable SMTP relay or webhook must not be able to hang the command
+// indefinitely.
+const sinkTimeout = 10 * time.Second
+
+var httpClient = &http.Client{Timeout: sinkTimeout}
+
+// EventType identifies what happened to a RAID array.
+type EventType string
+
+const (
+	EventCheckStarted   EventType = "check_started"
+	EventCheckCompleted EventType = "check_completed"
+	EventCheckPaused    EventType = "check_paused"
+	EventCheckStalled   EventType = "check_stalled"
+	EventDeviceDegraded EventType = "device_degraded"
+	EventRebootPending  EventType = "reboot_pending"
+	EventRebooting      EventType = "rebooting"
+)
+
+// Event describes a single notable occurrence, published to every
+// configured sink.
+type Event struct {
+	Type     EventType
+	Array    string
+	Progress float64
+	ETA      string
+	Message  string
+	At       time.Time
+}
+
+// NotifyConfig is the on-disk schema for the `notify` subcommand's sink
+// configuration.
+type NotifyConfig struct {
+	StallAfterMinutes int         `yaml:"stall_after_minutes"`
+	Sinks             SinksConfig `yaml:"sinks"`
+}
+
+// SinksConfig lists the notification sinks a user may configure. Any
+// combination may be set; each configured sink receives every event.
+type SinksConfig struct {
+	SMTP    *SMTPSinkConfig    `yaml:"smtp"`
+	Webhook *WebhookSinkConfig `yaml:"webhook"`
+	Slack   *ChatSinkConfig    `yaml:"slack"`
+	Discord *ChatSinkConfig    `yaml:"discord"`
+}
+
+// SMTPSinkConfig configures email delivery via a plain SMTP relay.
+type SMTPSinkConfig struct {
+	Host     string   `yaml:"host"` // "host:port"
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// WebhookSinkConfig posts a JSON event payload to an arbitrary URL.
+type WebhookSinkConfig struct {
+	URL string `yaml:"url"`
+}
+
+// ChatSinkConfig posts a rendered message to a Slack- or Discord-style
+// incoming webhook. Template defaults to defaultChatTemplate if unset.
+type ChatSinkConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+	Template   string `yaml:"template"`
+}
+
+const defaultChatTemplate = `RAID {{.Type}} on {{.Array}} ({{printf "%.1f" .Progress}}%)`
+
+// Sink delivers an Event to some external system.
+type Sink interface {
+	Notify(Event) error
+}
+
+// loadNotifyConfig reads and parses a notify sink configuration file.
+func loadNotifyConfig(path string) (*NotifyConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var cfg NotifyConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// notifier fans an Event out to every configured sink, logging (rather than
+// failing the caller) any sink that errors.
+type notifier struct {
+	sinks []Sink
+}
+
+// newNotifier builds a notifier from a NotifyConfig, failing only if a sink
+// is misconfigured (e.g. an invalid chat template).
+func newNotifier(cfg *NotifyConfig) (*notifier, error) {
+	sinks, err := buildSinks(&cfg.Sinks)
+	if err != nil {
+		return nil, err
+	}
+	return &notifier{sinks: sinks}, nil
+}
+
+func buildSinks(cfg *SinksConfig) ([]Sink, error) {
+	var sinks []Sink
+
+	if cfg.SMTP != nil {
+		sinks = append(sinks, &smtpSink{cfg: cfg.SMTP})
+	}
+	if cfg.Webhook != nil {
+		sinks = append(sinks, &webhookSink{cfg: cfg.Webhook})
+	}
+	if cfg.Slack != nil {
+		sink, err := newChatSink(cfg.Slack, "text")
+		if err != nil {
+			return nil, fmt.Errorf("slack sink: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.Discord != nil {
+		sink, err := newChatSink(cfg.Discord, "content")
+		if err != nil {
+			return nil, fmt.Errorf("discord sink: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return sinks, nil
+}
+
+// Notify delivers event to every sink, logging failures individually so one
+// broken sink doesn't suppress delivery to the others.
+func (n *notifier) Notify(event Event) {
+	for _, sink := range n.sinks {
+		if err := sink.Notify(event); err != nil {
+			log.Printf("notify: sink failed for %s event on %s: %v", event.Type, event.Array, err)
+		}
+	}
+}
+
+// notifyIfConfigured loads path (if non-empty) and sends event through it,
+// logging rather than failing the caller on any error. This lets commands
+// like reboot emit a best-effort notification without requiring a running
+// `notify` watcher.
+func notifyIfConfigured(path string, event Event) {
+	if path == "" {
+		return
+	}
+
+	cfg, err := loadNotifyConfig(path)
+	if err != nil {
+		log.Printf("notify: %v", err)
+		return
+	}
+
+	n, err := newNotifier(cfg)
+	if err != nil {
+		log.Printf("notify: %v", err)
+		return
+	}
+
+	n.Notify(event)
+}
+
+type smtpSink struct {
+	cfg *SMTPSinkConfig
+}
+
+func (s *smtpSink) Notify(event Event) error {
+	host := s.cfg.Host
+	if idx := strings.LastIndex(host, ":"); idx >= 0 {
+		host = host[:idx]
+	}
+
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, host)
+	}
+
+	subject := fmt.Sprintf("[raid-helper] %s on %s", event.Type, event.Array)
+	body := fmt.Sprintf("%s\n\nprogress: %.1f%%\neta: %s\nat: %s\n", eventMessage(event), event.Progress, event.ETA, event.At.Format(time.RFC3339))
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", s.cfg.From, strings.Join(s.cfg.To, ", "), subject, body)
+
+	return sendMailWithTimeout(s.cfg.Host, host, auth, s.cfg.From, s.cfg.To, []byte(msg))
+}
+
+// sendMailWithTimeout behaves like smtp.SendMail, but dials addr with a
+// bounded timeout instead of net.Dial's unbounded default, so a
+// unreachable SMTP relay can't hang the caller indefinitely.
+func sendMailWithTimeout(addr, host string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", addr, sinkTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to dial %s: %w", addr, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(sinkTimeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return fmt.Errorf("failed to create SMTP client for %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("SMTP STARTTLS failed: %w", err)
+		}
+	}
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP auth failed: %w", err)
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := client.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+type webhookEventPayload struct {
+	Array    string    `json:"array"`
+	Event    string    `json:"event"`
+	Progress float64   `json:"progress"`
+	ETA      string    `json:"eta,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+type webhookSink struct {
+	cfg *WebhookSinkConfig
+}
+
+func (s *webhookSink) Notify(event Event) error {
+	payload := webhookEventPayload{
+		Array:    event.Array,
+		Event:    string(event.Type),
+		Progress: event.Progress,
+		ETA:      event.ETA,
+		Message:  event.Message,
+		At:       event.At,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	return postJSON(s.cfg.URL, body)
+}
+
+// chatSink posts a templated message to a Slack- or Discord-style incoming
+// webhook, which both accept a JSON body with a single text field (named
+// differently by each service).
+type chatSink struct {
+	webhookURL string
+	tmpl       *template.Template
+	bodyField  string
+}
+
+func newChatSink(cfg *ChatSinkConfig, bodyField string) (*chatSink, error) {
+	text := cfg.Template
+	if text == "" {
+		text = defaultChatTemplate
+	}
+
+	tmpl, err := template.New("chat").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	return &chatSink{webhookURL: cfg.WebhookURL, tmpl: tmpl, bodyField: bodyField}, nil
+}
+
+func (s *chatSink) Notify(event Event) error {
+	var buf bytes.Buffer
+	if err := s.tmpl.Execute(&buf, event); err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+
+	body, err := json.Marshal(map[string]string{s.bodyField: buf.String()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal chat payload: %w", err)
+	}
+
+	return postJSON(s.webhookURL, body)
+}
+
+func postJSON(url string, body []byte) error {
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned status %s", url, resp.Status)
+	}
+
+	return nil
+}
+
+func eventMessage(event Event) string {
+	if event.Message != "" {
+		return event.Message
+	}
+	return fmt.Sprintf("%s on %s", event.Type, event.Array)
+}
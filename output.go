@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var deviceRoleRe = regexp.MustCompile(`\[(\d+)\]\s*$`)
+
+// statusSchemaVersion is bumped whenever StatusReport's shape changes in a
+// way that isn't purely additive.
+const statusSchemaVersion = 1
+
+// StatusReport is the schema emitted by --output=json for check, progress,
+// showstatus, and the default status view.
+type StatusReport struct {
+	SchemaVersion int           `json:"schema_version"`
+	GeneratedAt   time.Time     `json:"generated_at"`
+	Arrays        []ArrayReport `json:"arrays"`
+}
+
+// ArrayReport is the per-array portion of a StatusReport.
+type ArrayReport struct {
+	Name             string         `json:"name"`
+	SyncAction       string         `json:"sync_action"`
+	ProgressPercent  float64        `json:"progress_percent"`
+	ETASeconds       *float64       `json:"eta_seconds,omitempty"`
+	SpeedBytesPerSec *float64       `json:"speed_bytes_per_sec,omitempty"`
+	MinSpeedKBps     float64        `json:"min_speed_limit_kbps"`
+	MaxSpeedKBps     float64        `json:"max_speed_limit_kbps"`
+	Devices          []DeviceReport `json:"devices"`
+}
+
+// DeviceReport is the state of one member device within an array.
+type DeviceReport struct {
+	Name  string `json:"name"`
+	State string `json:"state"` // "up", "failed", or "unknown"
+}
+
+// parseOutputFormat validates the --output flag value.
+func parseOutputFormat(s string) (string, error) {
+	switch s {
+	case "text", "json":
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid --output %q (want text or json)", s)
+	}
+}
+
+// renderStatus prints the current status of selected in either JSON (via
+// buildStatusReport) or text (via textFn, the command's existing rendering).
+func renderStatus(selected []string, format string, textFn func([]string) error) error {
+	if format == "json" {
+		report, err := buildStatusReport(selected)
+		if err != nil {
+			return err
+		}
+		return printJSON(report)
+	}
+
+	return textFn(selected)
+}
+
+// runStatusLoop calls render once, then repeats every interval until the
+// process is killed if watch is true. This is what gives status commands
+// their --watch NDJSON streaming mode.
+func runStatusLoop(watch bool, interval time.Duration, render func() error) error {
+	if err := render(); err != nil {
+		return err
+	}
+	if !watch {
+		return nil
+	}
+
+	for {
+		time.Sleep(interval)
+		if err := render(); err != nil {
+			log.Printf("Error rendering status: %v", err)
+		}
+	}
+}
+
+// buildStatusReport gathers the current state of the selected arrays into
+// the JSON-serializable StatusReport schema.
+func buildStatusReport(selected []string) (StatusReport, error) {
+	arrays, err := getArrayStatuses(selected)
+	if err != nil {
+		return StatusReport{}, err
+	}
+
+	minSpeedKB, err := readSpeedKB(getMinSpeed)
+	if err != nil {
+		log.Printf("Error reading min speed limit: %v", err)
+	}
+	maxSpeedKB, err := readSpeedKB(getCurrentSpeed)
+	if err != nil {
+		log.Printf("Error reading max speed limit: %v", err)
+	}
+
+	report := StatusReport{
+		SchemaVersion: statusSchemaVersion,
+		GeneratedAt:   time.Now(),
+		Arrays:        make([]ArrayReport, 0, len(arrays)),
+	}
+
+	for _, a := range arrays {
+		ar := ArrayReport{
+			Name:            a.Name,
+			SyncAction:      a.SyncAction,
+			ProgressPercent: a.Progress,
+			MinSpeedKBps:    minSpeedKB,
+			MaxSpeedKBps:    maxSpeedKB,
+			Devices:         deviceReports(a),
+		}
+		if a.ETA != "" {
+			if seconds, err := parseEtaSeconds(a.ETA); err == nil {
+				ar.ETASeconds = &seconds
+			}
+		}
+		if a.Speed != "" {
+			if bps, err := parseSpeedBytesPerSec(a.Speed); err == nil {
+				ar.SpeedBytesPerSec = &bps
+			}
+		}
+		report.Arrays = append(report.Arrays, ar)
+	}
+
+	return report, nil
+}
+
+func readSpeedKB(read func() (string, error)) (float64, error) {
+	raw, err := read()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(raw, 64)
+}
+
+// deviceReports pairs each member device with its state, matched by the
+// role number embedded in its mdstat token (e.g. "sda1[0]") against the
+// same position in the array's device map bitmap. The role number, not
+// list order, is authoritative: after a disk replacement the device list
+// and the bitmap can disagree on ordering.
+func deviceReports(a ArrayStatus) []DeviceReport {
+	reports := make([]DeviceReport, 0, len(a.Devices))
+	for _, d := range a.Devices {
+		state := "unknown"
+		if role, ok := deviceRole(d); ok && role < len(a.DeviceMap) {
+			if a.DeviceMap[role] == '_' {
+				state = "failed"
+			} else {
+				state = "up"
+			}
+		}
+		reports = append(reports, DeviceReport{Name: d, State: state})
+	}
+	return reports
+}
+
+// deviceRole extracts the role number from an mdstat device token such as
+// "sda1[0]".
+func deviceRole(device string) (int, bool) {
+	m := deviceRoleRe.FindStringSubmatch(device)
+	if m == nil {
+		return 0, false
+	}
+	role, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+	return role, true
+}
+
+// parseSpeedBytesPerSec converts an mdstat speed= value such as "12345K/sec"
+// into bytes per second.
+func parseSpeedBytesPerSec(speed string) (float64, error) {
+	value := strings.TrimSuffix(speed, "/sec")
+
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1024
+		value = strings.TrimSuffix(value, "K")
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1024 * 1024
+		value = strings.TrimSuffix(value, "M")
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse speed %q: %w", speed, err)
+	}
+
+	return number * multiplier, nil
+}
+
+// printJSON marshals report as a single compact JSON line, so repeated calls
+// under --watch produce valid NDJSON.
+func printJSON(report StatusReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status report: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultPauseStateDir is where the scheduler records which arrays it has
+// idled via the pause guard, so the notify watcher can tell a
+// scheduler-initiated pause apart from a check that actually finished.
+const defaultPauseStateDir = "/run/raid-helper/paused"
+
+// markArrayPaused records that array was idled by the pause guard.
+func markArrayPaused(dir, array string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create pause state dir %s: %w", dir, err)
+	}
+	if err := os.WriteFile(pauseMarkerPath(dir, array), nil, 0644); err != nil {
+		return fmt.Errorf("failed to mark %s paused: %w", array, err)
+	}
+	return nil
+}
+
+// clearArrayPaused removes array's pause marker, if any.
+func clearArrayPaused(dir, array string) error {
+	if err := os.Remove(pauseMarkerPath(dir, array)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear pause marker for %s: %w", array, err)
+	}
+	return nil
+}
+
+// arrayPaused reports whether array currently has a pause marker.
+func arrayPaused(dir, array string) bool {
+	_, err := os.Stat(pauseMarkerPath(dir, array))
+	return err == nil
+}
+
+func pauseMarkerPath(dir, array string) string {
+	return filepath.Join(dir, array)
+}
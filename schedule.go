@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ScheduleConfig is the on-disk schema for the `schedule` subcommand's
+// policy file.
+type ScheduleConfig struct {
+	CheckInterval Duration     `yaml:"check_interval"`
+	Policies      []TimePolicy `yaml:"policies"`
+	LoadGuard     *LoadGuard   `yaml:"load_guard"`
+	PauseGuard    *PauseGuard  `yaml:"pause_guard"`
+}
+
+// TimePolicy pins a speed to a daily time-of-day window, e.g. "high between
+// 02:00 and 06:00".
+type TimePolicy struct {
+	Name  string `yaml:"name"`
+	Speed string `yaml:"speed"` // "normal", "high", or "low"
+	Start string `yaml:"start"` // "15:04"-formatted, local time
+	End   string `yaml:"end"`   // "15:04"-formatted, local time
+}
+
+// LoadGuard throttles to a lower speed whenever the host looks busy.
+type LoadGuard struct {
+	MaxLoad1            float64 `yaml:"max_load1"`
+	MaxDiskThroughputKB float64 `yaml:"max_disk_throughput_kbps"`
+	Speed               string  `yaml:"speed"`
+}
+
+// PauseGuard idles checks entirely when sustained non-check I/O is detected,
+// resuming them after a cooldown.
+type PauseGuard struct {
+	IOThresholdKBps    float64 `yaml:"io_threshold_kbps"`
+	SustainedMinutes   int     `yaml:"sustained_minutes"`
+	ResumeAfterMinutes int     `yaml:"resume_after_minutes"`
+}
+
+// Duration wraps time.Duration so the config file can use strings like
+// "30s" or "5m".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	parsed, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", value.Value, err)
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// loadScheduleConfig reads and parses a schedule policy file.
+func loadScheduleConfig(path string) (*ScheduleConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var cfg ScheduleConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// diskStat is a snapshot of cumulative sector counts for one block device,
+// as reported by /proc/diskstats.
+type diskStat struct {
+	sectorsRead    uint64
+	sectorsWritten uint64
+}
+
+// readDiskStats parses /proc/diskstats into a map keyed by device name,
+// keeping only whole-disk entries. /proc/diskstats also carries a line per
+// partition, and the kernel already folds partition I/O into its whole
+// disk's counters, so including both would double-count every sector.
+func readDiskStats() (map[string]diskStat, error) {
+	wholeDisks, err := wholeDiskNames()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open("/proc/diskstats")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open /proc/diskstats: %w", err)
+	}
+	defer file.Close()
+
+	stats := make(map[string]diskStat)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+
+		name := fields[2]
+		if !wholeDisks[name] {
+			continue
+		}
+
+		sectorsRead, err := strconv.ParseUint(fields[5], 10, 64)
+		if err != nil {
+			continue
+		}
+		sectorsWritten, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		stats[name] = diskStat{sectorsRead: sectorsRead, sectorsWritten: sectorsWritten}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read /proc/diskstats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// wholeDiskNames lists the whole-disk block devices on the host, as seen
+// under /sys/block (which, unlike /proc/diskstats, has no entries for
+// partitions).
+func wholeDiskNames() (map[string]bool, error) {
+	matches, err := filepath.Glob("/sys/block/*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to glob /sys/block: %w", err)
+	}
+
+	names := make(map[string]bool, len(matches))
+	for _, m := range matches {
+		names[filepath.Base(m)] = true
+	}
+	return names, nil
+}
+
+// diskThroughputKBps sums the sector deltas between two /proc/diskstats
+// snapshots into an approximate throughput, excluding any device in
+// exclude. exclude is meant to hold the checked arrays' own backing disks
+// (and the arrays themselves), so this measures I/O from devices unrelated
+// to the check, i.e. "someone else is using the disks right now" rather
+// than the check's own reads.
+func diskThroughputKBps(prev, cur map[string]diskStat, elapsed time.Duration, exclude map[string]bool) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+
+	var sectors uint64
+	for name, c := range cur {
+		if exclude[name] {
+			continue
+		}
+		p, ok := prev[name]
+		if !ok {
+			continue
+		}
+		sectors += (c.sectorsRead - p.sectorsRead) + (c.sectorsWritten - p.sectorsWritten)
+	}
+
+	bytesPerSecond := float64(sectors*512) / elapsed.Seconds()
+	return bytesPerSecond / 1024
+}
+
+// readLoad1 returns the 1-minute load average from /proc/loadavg.
+func readLoad1() (float64, error) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read /proc/loadavg: %w", err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected /proc/loadavg contents: %q", data)
+	}
+
+	load1, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse load average %q: %w", fields[0], err)
+	}
+
+	return load1, nil
+}
+
+// activeTimePolicy returns the first policy whose [start, end) window
+// contains now, in local time.
+func activeTimePolicy(policies []TimePolicy, now time.Time) (*TimePolicy, error) {
+	for i, p := range policies {
+		inWindow, err := withinWindow(now, p.Start, p.End)
+		if err != nil {
+			return nil, fmt.Errorf("policy %q: %w", p.Name, err)
+		}
+		if inWindow {
+			return &policies[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func withinWindow(now time.Time, start, end string) (bool, error) {
+	startHour, startMin, err := parseClock(start)
+	if err != nil {
+		return false, err
+	}
+	endHour, endMin, err := parseClock(end)
+	if err != nil {
+		return false, err
+	}
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	startT := midnight.Add(time.Duration(startHour)*time.Hour + time.Duration(startMin)*time.Minute)
+	endT := midnight.Add(time.Duration(endHour)*time.Hour + time.Duration(endMin)*time.Minute)
+
+	if endT.Before(startT) {
+		// Window wraps past midnight, e.g. 22:00-06:00.
+		return !now.Before(startT) || now.Before(endT), nil
+	}
+	return !now.Before(startT) && now.Before(endT), nil
+}
+
+func parseClock(s string) (hour, minute int, err error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	hour, err = strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid hour in %q: %w", s, err)
+	}
+	minute, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid minute in %q: %w", s, err)
+	}
+	return hour, minute, nil
+}
+
+// scheduler runs the adaptive speed and pause policies on a timer, logging
+// every speed/pause transition it makes.
+type scheduler struct {
+	cfg           *ScheduleConfig
+	selected      []string
+	pauseStateDir string
+
+	lastSpeed    string
+	prevStats    map[string]diskStat
+	prevSampleAt time.Time
+	highIOSince  time.Time
+	paused       bool
+	pausedArrays []string
+	resumeAt     time.Time
+}
+
+// runScheduler loads cfg from configPath and evaluates it forever, sleeping
+// cfg.CheckInterval (default 1 minute) between evaluations.
+func runScheduler(configPath string, selected []string, pauseStateDir string) error {
+	cfg, err := loadScheduleConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	interval := cfg.CheckInterval.Duration
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	s := &scheduler{cfg: cfg, selected: selected, pauseStateDir: pauseStateDir}
+	for {
+		if err := s.tick(); err != nil {
+			log.Printf("schedule: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (s *scheduler) tick() error {
+	now := time.Now()
+
+	throughput, throughputOK, err := s.sampleDiskThroughput(now)
+	if err != nil {
+		log.Printf("schedule: failed to sample disk throughput: %v", err)
+	}
+
+	if err := s.evaluatePauseGuard(now, throughput, throughputOK); err != nil {
+		return fmt.Errorf("pause guard: %w", err)
+	}
+	if s.paused {
+		return nil
+	}
+	return s.evaluateSpeed(now, throughput, throughputOK)
+}
+
+// evaluateSpeed picks the desired speed from the active time policy, then
+// overrides it with the load guard's speed if the host looks busy, and
+// applies it if it differs from the last speed we set.
+func (s *scheduler) evaluateSpeed(now time.Time, throughput float64, throughputOK bool) error {
+	desired := ""
+	if policy, err := activeTimePolicy(s.cfg.Policies, now); err != nil {
+		return err
+	} else if policy != nil {
+		desired = policy.Speed
+	}
+
+	if s.cfg.LoadGuard != nil {
+		busy, err := s.loadGuardTripped(throughput, throughputOK)
+		if err != nil {
+			log.Printf("schedule: load guard check failed: %v", err)
+		} else if busy {
+			desired = s.cfg.LoadGuard.Speed
+		}
+	}
+
+	if desired == "" || desired == s.lastSpeed {
+		return nil
+	}
+
+	speed, err := speedForName(desired)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("schedule: switching speed from %q to %q", orZero(s.lastSpeed), desired)
+	if err := setSpeed(speed); err != nil {
+		return fmt.Errorf("failed to set speed %q: %w", desired, err)
+	}
+	s.lastSpeed = desired
+
+	return nil
+}
+
+func (s *scheduler) loadGuardTripped(throughput float64, throughputOK bool) (bool, error) {
+	guard := s.cfg.LoadGuard
+
+	if guard.MaxLoad1 > 0 {
+		load1, err := readLoad1()
+		if err != nil {
+			return false, err
+		}
+		if load1 > guard.MaxLoad1 {
+			return true, nil
+		}
+	}
+
+	if guard.MaxDiskThroughputKB > 0 && throughputOK && throughput > guard.MaxDiskThroughputKB {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// sampleDiskThroughput returns the throughput observed since the previous
+// sample, excluding the selected arrays' own backing disks. ok is false on
+// the first call, since there is nothing to diff against yet. It is meant
+// to be called exactly once per tick.
+func (s *scheduler) sampleDiskThroughput(now time.Time) (kbps float64, ok bool, err error) {
+	cur, err := readDiskStats()
+	if err != nil {
+		return 0, false, err
+	}
+
+	exclude, err := s.excludedDevices()
+	if err != nil {
+		return 0, false, err
+	}
+
+	if s.prevStats == nil {
+		s.prevStats, s.prevSampleAt = cur, now
+		return 0, false, nil
+	}
+
+	kbps = diskThroughputKBps(s.prevStats, cur, now.Sub(s.prevSampleAt), exclude)
+	s.prevStats, s.prevSampleAt = cur, now
+
+	return kbps, true, nil
+}
+
+// excludedDevices returns the /proc/diskstats device names that back the
+// scheduler's selected arrays (or every array if none are selected), along
+// with the arrays themselves. The pause and load guards must ignore these:
+// during an active check, the check's own reads on these devices would
+// otherwise look identical to outside load.
+func (s *scheduler) excludedDevices() (map[string]bool, error) {
+	arrays, err := getArrayStatuses(s.selected)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude := make(map[string]bool, len(arrays))
+	for _, a := range arrays {
+		exclude[a.Name] = true
+		for _, dev := range a.Devices {
+			exclude[baseDeviceName(dev)] = true
+		}
+	}
+	return exclude, nil
+}
+
+// evaluatePauseGuard idles every selected array that is running a check
+// once non-check I/O has exceeded the configured threshold for
+// SustainedMinutes, and resumes them ResumeAfterMinutes after pausing.
+func (s *scheduler) evaluatePauseGuard(now time.Time, throughput float64, throughputOK bool) error {
+	guard := s.cfg.PauseGuard
+	if guard == nil {
+		return nil
+	}
+
+	if s.paused {
+		if now.Before(s.resumeAt) {
+			return nil
+		}
+		return s.resumeArrays(now)
+	}
+
+	if !throughputOK {
+		return nil
+	}
+
+	if throughput <= guard.IOThresholdKBps {
+		s.highIOSince = time.Time{}
+		return nil
+	}
+
+	if s.highIOSince.IsZero() {
+		s.highIOSince = now
+		return nil
+	}
+
+	if now.Sub(s.highIOSince) < time.Duration(guard.SustainedMinutes)*time.Minute {
+		return nil
+	}
+
+	return s.pauseArrays(now)
+}
+
+func (s *scheduler) pauseArrays(now time.Time) error {
+	statuses, err := getArrayStatuses(s.selected)
+	if err != nil {
+		return err
+	}
+	var arrays []string
+	for _, a := range statuses {
+		if a.Checking() {
+			arrays = append(arrays, a.Name)
+		}
+	}
+
+	log.Printf("schedule: sustained non-check I/O detected, pausing checks on %s", strings.Join(arrays, ", "))
+	for _, name := range arrays {
+		if err := setSyncAction(name, "idle"); err != nil {
+			log.Printf("schedule: failed to idle %s: %v", name, err)
+			continue
+		}
+		s.pausedArrays = append(s.pausedArrays, name)
+		if err := markArrayPaused(s.pauseStateDir, name); err != nil {
+			log.Printf("schedule: %v", err)
+		}
+	}
+
+	s.paused = true
+	s.resumeAt = now.Add(time.Duration(s.cfg.PauseGuard.ResumeAfterMinutes) * time.Minute)
+
+	return nil
+}
+
+func (s *scheduler) resumeArrays(now time.Time) error {
+	arrays := s.pausedArrays
+
+	log.Printf("schedule: resuming checks on %s", strings.Join(arrays, ", "))
+	for _, name := range arrays {
+		if err := setSyncAction(name, "check"); err != nil {
+			log.Printf("schedule: failed to resume %s: %v", name, err)
+		}
+		if err := clearArrayPaused(s.pauseStateDir, name); err != nil {
+			log.Printf("schedule: %v", err)
+		}
+	}
+
+	s.paused = false
+	s.pausedArrays = nil
+	s.highIOSince = time.Time{}
+
+	return nil
+}
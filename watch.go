@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// arrayObservation is the last state a watcher saw for one array, used to
+// detect transitions worth notifying about.
+type arrayObservation struct {
+	syncAction   string
+	lastProgress float64
+	progressAt   time.Time
+	stalled      bool
+	degraded     bool
+}
+
+// watcher polls array status on an interval and emits Events for check
+// start/completion/stall and device degradation.
+type watcher struct {
+	selected      []string
+	notifier      *notifier
+	stallAfter    time.Duration
+	pauseStateDir string
+	state         map[string]*arrayObservation
+}
+
+// runNotifyWatch loads a NotifyConfig from configPath and watches the
+// selected arrays forever, sleeping interval between polls. pauseStateDir
+// is where the schedule command's pause guard records arrays it has idled,
+// so a scheduler-initiated pause can be reported as such instead of as a
+// completed check.
+func runNotifyWatch(configPath string, selected []string, interval time.Duration, pauseStateDir string) error {
+	cfg, err := loadNotifyConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	n, err := newNotifier(cfg)
+	if err != nil {
+		return err
+	}
+
+	stallAfter := time.Duration(cfg.StallAfterMinutes) * time.Minute
+	if stallAfter <= 0 {
+		stallAfter = 30 * time.Minute
+	}
+
+	w := &watcher{
+		selected:      selected,
+		notifier:      n,
+		stallAfter:    stallAfter,
+		pauseStateDir: pauseStateDir,
+		state:         make(map[string]*arrayObservation),
+	}
+
+	for {
+		if err := w.tick(); err != nil {
+			log.Printf("notify: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (w *watcher) tick() error {
+	arrays, err := getArrayStatuses(w.selected)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, a := range arrays {
+		w.observe(a, now)
+	}
+
+	return nil
+}
+
+func (w *watcher) observe(a ArrayStatus, now time.Time) {
+	obs, seen := w.state[a.Name]
+	if !seen {
+		obs = &arrayObservation{syncAction: a.SyncAction, lastProgress: a.Progress, progressAt: now, degraded: a.Degraded()}
+		w.state[a.Name] = obs
+		return
+	}
+
+	wasChecking := obs.syncAction == "check"
+	if a.Checking() && !wasChecking {
+		w.notifier.Notify(Event{Type: EventCheckStarted, Array: a.Name, Progress: a.Progress, ETA: a.ETA, At: now})
+		obs.lastProgress = a.Progress
+		obs.progressAt = now
+		obs.stalled = false
+	}
+	if !a.Checking() && wasChecking {
+		eventType := EventCheckCompleted
+		if w.pauseStateDir != "" && arrayPaused(w.pauseStateDir, a.Name) {
+			eventType = EventCheckPaused
+		}
+		w.notifier.Notify(Event{Type: eventType, Array: a.Name, Progress: obs.lastProgress, At: now})
+		obs.stalled = false
+	}
+
+	if a.Checking() {
+		if a.Progress != obs.lastProgress {
+			obs.lastProgress = a.Progress
+			obs.progressAt = now
+			obs.stalled = false
+		} else if !obs.stalled && now.Sub(obs.progressAt) >= w.stallAfter {
+			w.notifier.Notify(Event{
+				Type:     EventCheckStalled,
+				Array:    a.Name,
+				Progress: a.Progress,
+				ETA:      a.ETA,
+				Message:  fmt.Sprintf("progress unchanged for %s", now.Sub(obs.progressAt).Round(time.Minute)),
+				At:       now,
+			})
+			obs.stalled = true
+		}
+	}
+
+	if degraded := a.Degraded(); degraded && !obs.degraded {
+		w.notifier.Notify(Event{Type: EventDeviceDegraded, Array: a.Name, Message: fmt.Sprintf("device map [%s]", a.DeviceMap), At: now})
+		obs.degraded = degraded
+	} else if !degraded {
+		obs.degraded = false
+	}
+
+	obs.syncAction = a.SyncAction
+}